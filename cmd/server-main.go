@@ -17,17 +17,26 @@
 package cmd
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/minio/cli"
 )
 
+// Default grace period given to in-flight requests to finish before the
+// listener is torn down on SIGTERM/SIGINT. Overridden by MINIO_SHUTDOWN_TIMEOUT.
+const defaultShutdownTimeout = 5 * time.Second
+
 var serverFlags = []cli.Flag{
 	cli.StringFlag{
 		Name:  "address",
@@ -38,6 +47,14 @@ var serverFlags = []cli.Flag{
 		Name:  "ignore-disks",
 		Usage: "Specify comma separated list of disks that are offline.",
 	},
+	cli.StringFlag{
+		Name:  "config-topology",
+		Usage: "Specify a topology file describing nodes, endpoints, disks and erasure-set groupings, replaces positional disk arguments.",
+	},
+	cli.BoolFlag{
+		Name:  "replication-only",
+		Usage: "Opt into mixing cloud storage disks (s3://, gs://, azure://) into the disk list, exempting it from the even disk count required for erasure coding.",
+	},
 }
 
 var serverCmd = cli.Command{
@@ -66,6 +83,10 @@ ENVIRONMENT VARIABLES:
   SECURITY:
      MINIO_SECURE_CONSOLE: Set secure console to '0' to disable printing secret key. Defaults to '1'.
 
+  METRICS & TRACING:
+     MINIO_METRICS_AUTH_TOKEN: Bearer token required to query the /minio/metrics endpoint. Metrics are disabled if unset.
+     MINIO_TRACE_ENDPOINT: Endpoint requests are traced to, for following a single PUT/GET across erasure disks and lock RPCs.
+
 EXAMPLES:
   1. Start minio server.
       $ minio {{.Name}} /home/shared
@@ -92,6 +113,11 @@ EXAMPLES:
       $ minio {{.Name}} 192.168.1.11:/mnt/export/ 192.168.1.12:/mnt/export/ \
           192.168.1.13:/mnt/export/ 192.168.1.14:/mnt/export/
 
+  7. Start minio server mixing local disks with a cloud storage tier,
+     opting into the uneven data/parity split this requires.
+      $ minio {{.Name}} --replication-only /mnt/local1/ /mnt/local2/ \
+          /mnt/local3/ /mnt/local4/ s3://cold-bucket/tier?region=us-east-1
+
 `,
 }
 
@@ -101,6 +127,132 @@ type serverCmdConfig struct {
 	ignoredDisks []string
 	isDistXL     bool // True only if its distributed XL.
 	storageDisks []StorageAPI
+	// erasureSets groups storageDisks by the data/parity sets described
+	// in a --config-topology file. Empty when the server was started
+	// with positional disk arguments instead of a topology file.
+	erasureSets [][]StorageAPI
+	// topology is set when the server was started with --config-topology,
+	// so configureServerHandler can register the topology verification
+	// RPC service peers query at startup. Nil otherwise.
+	topology *serverTopology
+	// shutdownCh is closed once a SIGTERM/SIGINT has drained in-flight
+	// requests and torn down the object layer, letting serverMain return.
+	shutdownCh chan struct{}
+}
+
+// globalCertMu/globalCert back the TLS GetCertificate closure so that a
+// SIGHUP can rotate the certificate pair without dropping the listener.
+var (
+	globalCertMu sync.RWMutex
+	globalCert   *tls.Certificate
+)
+
+// loadTLSCertificate reads the certificate/key pair configured for this node.
+func loadTLSCertificate() (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(mustGetCertFile(), mustGetKeyFile())
+	if err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// getCertificate is installed as tls.Config.GetCertificate so that certs
+// reloaded on SIGHUP take effect for new connections without restarting
+// the listener.
+func getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	globalCertMu.RLock()
+	defer globalCertMu.RUnlock()
+	if globalCert == nil {
+		return nil, fmt.Errorf("no TLS certificate loaded")
+	}
+	return globalCert, nil
+}
+
+// reloadTLSCertificate re-reads the certificate/key pair from disk and
+// atomically swaps it in for getCertificate to pick up.
+func reloadTLSCertificate() error {
+	cert, err := loadTLSCertificate()
+	if err != nil {
+		return err
+	}
+	globalCertMu.Lock()
+	globalCert = cert
+	globalCertMu.Unlock()
+	return nil
+}
+
+// getShutdownTimeout returns the grace period allowed for in-flight
+// requests to finish draining on SIGTERM/SIGINT, configurable through
+// MINIO_SHUTDOWN_TIMEOUT.
+func getShutdownTimeout() time.Duration {
+	shutdownTimeoutStr := os.Getenv("MINIO_SHUTDOWN_TIMEOUT")
+	if shutdownTimeoutStr == "" {
+		return defaultShutdownTimeout
+	}
+	shutdownTimeout, err := time.ParseDuration(shutdownTimeoutStr)
+	fatalIf(err, "Unable to convert MINIO_SHUTDOWN_TIMEOUT=%s environment variable into its time.Duration value.", shutdownTimeoutStr)
+	return shutdownTimeout
+}
+
+// reloadServerConfig re-reads serverConfig from disk and hot-reloads
+// credentials, notification targets and the TLS certificate pair in
+// response to a SIGHUP, without dropping the listener.
+func reloadServerConfig(srvConfig *serverCmdConfig) {
+	if err := loadConfig(); err != nil {
+		errorIf(err, "Unable to reload server config on SIGHUP.")
+		return
+	}
+
+	if err := initEventNotifier(newObjectLayerFn()); err != nil {
+		errorIf(err, "Unable to reload event notification targets on SIGHUP.")
+	}
+
+	if isSSL() {
+		if err := reloadTLSCertificate(); err != nil {
+			errorIf(err, "Unable to reload TLS certificate on SIGHUP.")
+		}
+	}
+}
+
+// shutdownServer drains in-flight requests on apiServer within the
+// configured shutdown timeout and unmounts the object layer before
+// signalling serverMain to return. Lock and topology RPCs are served over
+// this same router, so they stop accepting new requests the moment the
+// listener is shut down; nsLockMap only exposes a per-resource
+// ForceUnlock(volume, path), not a bulk "release everything this node
+// holds" call, so there is nothing further to quiesce here beyond letting
+// dsync's lock TTL reclaim whatever this node was holding.
+func shutdownServer(srvConfig *serverCmdConfig, apiServer *ServerMux) {
+	drainTimeout := getShutdownTimeout()
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	if err := apiServer.Server.Shutdown(ctx); err != nil {
+		errorIf(err, "Unable to gracefully shutdown API server within %s.", drainTimeout)
+	}
+
+	if objAPI := newObjectLayerFn(); objAPI != nil {
+		objAPI.Shutdown()
+	}
+
+	close(srvConfig.shutdownCh)
+}
+
+// handleServerSignals installs the SIGTERM/SIGINT/SIGHUP handler for a
+// running server. SIGTERM and SIGINT trigger a graceful shutdown, SIGHUP
+// triggers a hot configuration reload.
+func handleServerSignals(srvConfig *serverCmdConfig, apiServer *ServerMux) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	for sig := range sigCh {
+		switch sig {
+		case syscall.SIGHUP:
+			reloadServerConfig(srvConfig)
+		case syscall.SIGTERM, syscall.SIGINT:
+			shutdownServer(srvConfig, apiServer)
+			return
+		}
+	}
 }
 
 // getListenIPs - gets all the ips to listen on.
@@ -167,6 +319,17 @@ func initServerConfig(c *cli.Context) {
 		fatalIf(err, "Unable to convert MINIO_CACHE_SIZE=%s environment variable into its integer value.", maxCacheSizeStr)
 	}
 
+	// Fetch the bearer token that protects the /minio/metrics endpoint.
+	if metricsToken := os.Getenv("MINIO_METRICS_AUTH_TOKEN"); metricsToken != "" {
+		globalMetricsAuthToken = metricsToken
+	}
+
+	// Fetch the endpoint that request traces are exported to.
+	if traceEndpoint := os.Getenv("MINIO_TRACE_ENDPOINT"); traceEndpoint != "" {
+		globalTraceEndpoint = traceEndpoint
+		fatalIf(initTracer(globalTraceEndpoint), "Unable to initialize request tracing.")
+	}
+
 	// Fetch cache expiry from environment variable.
 	if cacheExpiryStr := os.Getenv("MINIO_CACHE_EXPIRY"); cacheExpiryStr != "" {
 		// We need to parse cache expiry to its time.Duration value.
@@ -211,7 +374,7 @@ func initServerConfig(c *cli.Context) {
 }
 
 // Validate if input disks are sufficient for initializing XL.
-func checkSufficientDisks(disks []string) error {
+func checkSufficientDisks(disks []string, replicationOnly bool) error {
 	// Verify total number of disks.
 	totalDisks := len(disks)
 	if totalDisks > maxErasureBlocks {
@@ -228,7 +391,14 @@ func checkSufficientDisks(disks []string) error {
 
 	// Verify if we have even number of disks.
 	// only combination of 4, 6, 8, 10, 12, 14, 16 are supported.
-	if !isEven(totalDisks) {
+	// --replication-only exempts an odd disk count from this rule when
+	// the list also mixes in a cloud storage disk (s3://, gs://,
+	// azure://), since erasure coding across a cloud tier does not
+	// follow the same data/parity split as on-prem disks. This requires
+	// an explicit operator opt-in rather than being inferred from the
+	// disk list alone, so adding a single cold-storage disk to an
+	// otherwise-valid on-prem set can't silently change its layout.
+	if !isEven(totalDisks) && !(replicationOnly && hasCloudStorageDisks(disks)) {
 		return errXLNumDisks
 	}
 
@@ -239,6 +409,12 @@ func checkSufficientDisks(disks []string) error {
 // Validates if disks are of supported format, invalid arguments are rejected.
 func checkNamingDisks(disks []string) error {
 	for _, disk := range disks {
+		if isCloudStorageDisk(disk) {
+			if _, err := parseCloudStorageURI(disk); err != nil {
+				return err
+			}
+			continue
+		}
 		_, _, err := splitNetPath(disk)
 		if err != nil {
 			return err
@@ -248,7 +424,7 @@ func checkNamingDisks(disks []string) error {
 }
 
 // Validate input disks.
-func validateDisks(disks []string, ignoredDisks []string) []StorageAPI {
+func validateDisks(disks []string, ignoredDisks []string, replicationOnly bool) []StorageAPI {
 	isXL := len(disks) > 1
 	if isXL {
 		// Validate if input disks have duplicates in them.
@@ -256,7 +432,7 @@ func validateDisks(disks []string, ignoredDisks []string) []StorageAPI {
 		fatalIf(err, "Invalid disk arguments for server.")
 
 		// Validate if input disks are sufficient for erasure coded setup.
-		err = checkSufficientDisks(disks)
+		err = checkSufficientDisks(disks, replicationOnly)
 		fatalIf(err, "Invalid disk arguments for server.")
 
 		// Validate if input disks are properly named in accordance with either
@@ -265,8 +441,33 @@ func validateDisks(disks []string, ignoredDisks []string) []StorageAPI {
 		err = checkNamingDisks(disks)
 		fatalIf(err, "Invalid disk arguments for server.")
 	}
-	storageDisks, err := initStorageDisks(disks, ignoredDisks)
-	fatalIf(err, "Unable to initialize storage disks.")
+
+	// Cloud storage disks (s3://, gs://, azure://) are not handed to
+	// initStorageDisks - they are built directly here and spliced back
+	// into the result at their original position so the erasure set
+	// still sees disks in the order the operator listed them.
+	storageDisks := make([]StorageAPI, len(disks))
+	var localDisks []string
+	var localIdx []int
+	for i, d := range disks {
+		if isCloudStorageDisk(d) {
+			cloudDisk, err := newCloudStorage(d, i)
+			fatalIf(err, "Unable to initialize cloud storage disk %s.", d)
+			storageDisks[i] = cloudDisk
+			continue
+		}
+		localDisks = append(localDisks, d)
+		localIdx = append(localIdx, i)
+	}
+
+	if len(localDisks) > 0 {
+		localStorageDisks, err := initStorageDisks(localDisks, ignoredDisks)
+		fatalIf(err, "Unable to initialize storage disks.")
+		for j, idx := range localIdx {
+			storageDisks[idx] = localStorageDisks[j]
+		}
+	}
+
 	return storageDisks
 }
 
@@ -304,7 +505,8 @@ func isDistributedSetup(disks []string) (isDist bool) {
 
 // serverMain handler called for 'minio server' command.
 func serverMain(c *cli.Context) {
-	if !c.Args().Present() || c.Args().First() == "help" {
+	topologyFile := c.String("config-topology")
+	if (!c.Args().Present() && topologyFile == "") || c.Args().First() == "help" {
 		cli.ShowCommandHelpAndExit(c, "server", 1)
 	}
 
@@ -318,40 +520,64 @@ func serverMain(c *cli.Context) {
 	// Saves port in a globally accessible value.
 	globalMinioPort = port
 
-	// Disks to be ignored in server init, to skip format healing.
-	ignoredDisks := strings.Split(c.String("ignore-disks"), ",")
-
-	// Disks to be used in server init.
-	disks := c.Args()
-
 	// Initialize server config.
 	initServerConfig(c)
 
-	// Check 'server' cli arguments.
-	storageDisks := validateDisks(disks, ignoredDisks)
+	// Opt-in to exempting cloud storage disks from the even-disk-count
+	// rule; see checkSufficientDisks.
+	replicationOnly := c.Bool("replication-only")
+
+	var srvConfig serverCmdConfig
+	var disks []string
+	var topo serverTopology
+	if topologyFile != "" {
+		// A topology file replaces the positional disk list entirely,
+		// describing per-node endpoints, disks and erasure-set groupings.
+		var err error
+		topo, err = parseTopologyFile(topologyFile)
+		fatalIf(err, "Unable to parse topology file %s.", topologyFile)
+
+		srvConfig, err = buildServerCmdConfigFromTopology(topo, serverAddr, replicationOnly)
+		fatalIf(err, "Unable to configure server from topology file %s.", topologyFile)
+		srvConfig.shutdownCh = make(chan struct{})
+		disks = srvConfig.disks
+	} else {
+		// Disks to be ignored in server init, to skip format healing.
+		ignoredDisks := strings.Split(c.String("ignore-disks"), ",")
+
+		// Disks to be used in server init.
+		disks = c.Args()
+
+		// Check 'server' cli arguments.
+		storageDisks := validateDisks(disks, ignoredDisks, replicationOnly)
+
+		srvConfig = serverCmdConfig{
+			serverAddr:   serverAddr,
+			disks:        disks,
+			ignoredDisks: ignoredDisks,
+			storageDisks: storageDisks,
+			isDistXL:     isDistributedSetup(disks),
+			shutdownCh:   make(chan struct{}),
+		}
+	}
 
 	// If https.
-	tls := isSSL()
+	useSSL := isSSL()
 
 	// First disk argument check if it is local.
 	firstDisk := isLocalStorage(disks[0])
 
-	// Configure server.
-	srvConfig := serverCmdConfig{
-		serverAddr:   serverAddr,
-		disks:        disks,
-		ignoredDisks: ignoredDisks,
-		storageDisks: storageDisks,
-		isDistXL:     isDistributedSetup(disks),
-	}
-
 	// Configure server.
 	handler, err := configureServerHandler(srvConfig)
 	fatalIf(err, "Unable to configure one of server's RPC services.")
 
 	// Set nodes for dsync for distributed setup.
 	if srvConfig.isDistXL {
-		fatalIf(initDsyncNodes(disks, port), "Unable to initialize distributed locking")
+		if topologyFile != "" {
+			fatalIf(initDsyncNodesFromTopology(topo, serverAddr, port), "Unable to initialize distributed locking")
+		} else {
+			fatalIf(initDsyncNodes(disks, port), "Unable to initialize distributed locking")
+		}
 	}
 
 	// Initialize name space lock.
@@ -361,45 +587,90 @@ func serverMain(c *cli.Context) {
 	apiServer := NewServerMux(serverAddr, handler)
 
 	// Fetch endpoints which we are going to serve from.
-	endPoints := finalizeEndpoints(tls, &apiServer.Server)
+	endPoints := finalizeEndpoints(useSSL, &apiServer.Server)
 
 	// Start server, automatically configures TLS if certs are available.
-	go func(tls bool) {
+	go func(useTLS bool) {
 		var lerr error
-		if tls {
-			lerr = apiServer.ListenAndServeTLS(mustGetCertFile(), mustGetKeyFile())
+		if useTLS {
+			// Load the initial certificate pair and install a
+			// GetCertificate closure so a SIGHUP can rotate certs
+			// without dropping the listener.
+			lerr = reloadTLSCertificate()
+			fatalIf(lerr, "Unable to load TLS certificate.")
+			apiServer.Server.TLSConfig = &tls.Config{GetCertificate: getCertificate}
+			lerr = apiServer.ListenAndServeTLS("", "")
 		} else {
 			// Fallback to http.
 			lerr = apiServer.ListenAndServe()
 		}
-		fatalIf(lerr, "Failed to start minio server.")
-	}(tls)
-
-	// Wait for formatting of disks.
-	err = waitForFormatDisks(firstDisk, endPoints[0], storageDisks)
-	fatalIf(err, "formatting storage disks failed")
-
-	// Once formatted, initialize object layer.
-	newObject, err := newObjectLayer(storageDisks)
-	fatalIf(err, "intializing object layer failed")
-
-	globalObjLayerMutex.Lock()
-	globalObjectAPI = newObject
-	globalObjLayerMutex.Unlock()
-
-	// Initialize local server address
-	globalMinioAddr = getLocalAddress(srvConfig)
-
-	// Initialize S3 Peers inter-node communication
-	initGlobalS3Peers(disks)
-
-	// Initialize a new event notifier.
-	err = initEventNotifier(newObjectLayerFn())
-	fatalIf(err, "Unable to initialize event notification.")
+		if lerr != nil && lerr != http.ErrServerClosed {
+			fatalIf(lerr, "Failed to start minio server.")
+		}
+	}(useSSL)
+
+	// Now that this node's own Topology.Hash RPC is being served, cross
+	// check every peer's topology hash and refuse to continue starting
+	// up on a mismatch. Done after the listener starts (rather than
+	// before) so peers doing the same check concurrently can always
+	// reach this node.
+	if topologyFile != "" {
+		fatalIf(verifyClusterTopology(topo, serverAddr, port), "Topology mismatch across cluster nodes.")
+	}
 
-	// Prints the formatted startup message once object layer is initialized.
-	printStartupMessage(endPoints)
+	// Install the SIGTERM/SIGINT/SIGHUP handler so the node can drain
+	// in-flight requests and hot-reload configuration, rather than being
+	// killed outright. Installed before the startup sequence below, which
+	// can block for a long time on disk/erasure-set quorum, so a signal
+	// arriving mid-startup is still honored.
+	go handleServerSignals(&srvConfig, apiServer)
+
+	// The remaining startup steps (disk formatting, object layer init,
+	// peer/notifier setup) can block for a long time waiting on quorum.
+	// Run them in the background and race them against shutdownCh, so a
+	// SIGTERM/SIGINT received while still waiting on quorum is honored
+	// immediately instead of only once startup eventually completes.
+	startupDone := make(chan struct{})
+	go func() {
+		defer close(startupDone)
+
+		// Wait for formatting of disks.
+		err = waitForFormatDisks(firstDisk, endPoints[0], srvConfig.storageDisks)
+		fatalIf(err, "formatting storage disks failed")
+
+		// Once formatted, initialize object layer.
+		newObject, err := newObjectLayer(srvConfig.storageDisks)
+		fatalIf(err, "intializing object layer failed")
+
+		globalObjLayerMutex.Lock()
+		globalObjectAPI = newObject
+		globalObjLayerMutex.Unlock()
+
+		// Initialize local server address
+		globalMinioAddr = getLocalAddress(srvConfig)
+
+		// Initialize S3 Peers inter-node communication
+		initGlobalS3Peers(disks)
+
+		// Initialize a new event notifier.
+		err = initEventNotifier(newObjectLayerFn())
+		fatalIf(err, "Unable to initialize event notification.")
+
+		// Prints the formatted startup message once object layer is initialized.
+		printStartupMessage(endPoints)
+	}()
+
+	select {
+	case <-startupDone:
+	case <-srvConfig.shutdownCh:
+		return
+	}
 
-	// Waits on the server.
-	<-globalServiceDoneCh
+	// Waits on the server, either until the process is asked to restart
+	// the service, or until a SIGTERM/SIGINT has drained the server and
+	// shut down the object layer.
+	select {
+	case <-globalServiceDoneCh:
+	case <-srvConfig.shutdownCh:
+	}
 }
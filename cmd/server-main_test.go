@@ -0,0 +1,56 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestGetShutdownTimeout verifies MINIO_SHUTDOWN_TIMEOUT overrides the
+// default drain timeout, and that an unset/empty value falls back to it.
+func TestGetShutdownTimeout(t *testing.T) {
+	defer os.Unsetenv("MINIO_SHUTDOWN_TIMEOUT")
+
+	os.Unsetenv("MINIO_SHUTDOWN_TIMEOUT")
+	if got := getShutdownTimeout(); got != defaultShutdownTimeout {
+		t.Errorf("expected default shutdown timeout %s, got %s", defaultShutdownTimeout, got)
+	}
+
+	os.Setenv("MINIO_SHUTDOWN_TIMEOUT", "30s")
+	if got := getShutdownTimeout(); got != 30*time.Second {
+		t.Errorf("expected shutdown timeout 30s, got %s", got)
+	}
+}
+
+// TestShutdownServerClosesShutdownCh verifies shutdownServer closes
+// srvConfig.shutdownCh once it has drained a (never started) API server,
+// so serverMain's select does not block forever on SIGTERM/SIGINT.
+func TestShutdownServerClosesShutdownCh(t *testing.T) {
+	srvConfig := &serverCmdConfig{shutdownCh: make(chan struct{})}
+	apiServer := NewServerMux(":0", http.NotFoundHandler())
+
+	shutdownServer(srvConfig, apiServer)
+
+	select {
+	case <-srvConfig.shutdownCh:
+	default:
+		t.Fatal("expected shutdownCh to be closed after shutdownServer returns")
+	}
+}
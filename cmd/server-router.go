@@ -0,0 +1,45 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// configureServerHandler builds the HTTP handler serverMain listens on,
+// registering the RPC services distributed peers rely on (the topology
+// verification service, when started with --config-topology), the
+// Prometheus metrics endpoint, and request tracing, alongside the S3 API
+// router.
+func configureServerHandler(srvCmdConfig serverCmdConfig) (http.Handler, error) {
+	router := mux.NewRouter().SkipClean(true)
+	router.Use(metricsMiddleware)
+	router.Use(tracingMiddleware)
+
+	if srvCmdConfig.topology != nil {
+		if err := registerTopologyRPCRouter(router, *srvCmdConfig.topology); err != nil {
+			return nil, err
+		}
+	}
+
+	registerMetricsRouter(router)
+	registerAPIRouter(router, srvCmdConfig)
+
+	return router, nil
+}
@@ -0,0 +1,374 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/minio/minio-go"
+	"github.com/minio/minio/pkg/disk"
+)
+
+// Supported cloud storage URI schemes, used as StorageAPI tiers alongside
+// the existing posix/network disk variants.
+const (
+	cloudSchemeS3    = "s3"
+	cloudSchemeGCS   = "gs"
+	cloudSchemeAzure = "azure"
+)
+
+// cloudStorageURI holds the parsed components of a `s3://`, `gs://` or
+// `azure://` disk argument, e.g. `s3://cold-bucket/tier?region=us-east-1`.
+type cloudStorageURI struct {
+	scheme string
+	bucket string
+	prefix string
+	query  url.Values
+}
+
+// isCloudStorageDisk returns true if disk looks like a cloud storage URI
+// rather than a local path or `ip:/mnt/disk` network path.
+func isCloudStorageDisk(disk string) bool {
+	scheme := strings.ToLower(strings.SplitN(disk, "://", 2)[0])
+	switch scheme {
+	case cloudSchemeS3, cloudSchemeGCS, cloudSchemeAzure:
+		return strings.Contains(disk, "://")
+	default:
+		return false
+	}
+}
+
+// hasCloudStorageDisks returns true if any of disks is a cloud storage URI.
+func hasCloudStorageDisks(disks []string) bool {
+	for _, disk := range disks {
+		if isCloudStorageDisk(disk) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCloudStorageURI parses a `scheme://bucket/prefix?key=value` disk
+// argument into its components.
+func parseCloudStorageURI(disk string) (cloudStorageURI, error) {
+	u, err := url.Parse(disk)
+	if err != nil {
+		return cloudStorageURI{}, fmt.Errorf("invalid cloud storage disk %s: %s", disk, err)
+	}
+	if u.Host == "" {
+		return cloudStorageURI{}, fmt.Errorf("invalid cloud storage disk %s: missing bucket", disk)
+	}
+	return cloudStorageURI{
+		scheme: strings.ToLower(u.Scheme),
+		bucket: u.Host,
+		prefix: strings.TrimPrefix(u.Path, "/"),
+		query:  u.Query(),
+	}, nil
+}
+
+// credsEnvName returns the environment variable minio checks for
+// credentials of the n'th disk argument, e.g. MINIO_DISK_2_CREDS, used
+// when the URI itself does not carry an access/secret key pair as query
+// parameters.
+func credsEnvName(diskIndex int) string {
+	return fmt.Sprintf("MINIO_DISK_%d_CREDS", diskIndex)
+}
+
+// lookupCloudCreds resolves the access/secret key pair for a cloud disk,
+// preferring `access_key`/`secret_key` query parameters on the URI and
+// falling back to MINIO_DISK_<n>_CREDS as "access:secret".
+func lookupCloudCreds(uri cloudStorageURI, diskIndex int) (accessKey, secretKey string, err error) {
+	accessKey = uri.query.Get("access_key")
+	secretKey = uri.query.Get("secret_key")
+	if accessKey != "" && secretKey != "" {
+		return accessKey, secretKey, nil
+	}
+	creds := os.Getenv(credsEnvName(diskIndex))
+	if creds == "" {
+		return "", "", fmt.Errorf("no credentials configured for disk %d (%s://%s/%s), set %s",
+			diskIndex, uri.scheme, uri.bucket, uri.prefix, credsEnvName(diskIndex))
+	}
+	parts := strings.SplitN(creds, ":", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("invalid %s, expected \"access:secret\"", credsEnvName(diskIndex))
+	}
+	return parts[0], parts[1], nil
+}
+
+// cloudStorage implements StorageAPI on top of an S3-compatible bucket via
+// the vendored minio-go client, letting an erasure set mix on-prem disks
+// with a cloud tier. File paths are namespaced under uri.prefix so
+// multiple minio volumes can safely share a single bucket.
+//
+// gs:// and azure:// disks parse and validate the same way but are not
+// yet backed by the GCS/Azure SDKs; newCloudStorage rejects them outright
+// instead of silently returning a StorageAPI that fails on first I/O.
+type cloudStorage struct {
+	uri    cloudStorageURI
+	client *minio.Client
+	// ctx roots the tracing spans traceOp starts. Defaults to
+	// context.Background(); WithContext returns a copy bound to a
+	// request's context so its storage spans are children of the request
+	// span tracingMiddleware started instead of standing alone.
+	ctx context.Context
+}
+
+// newCloudStorage builds the StorageAPI for a single `scheme://bucket/prefix`
+// disk argument, looking up credentials by its position in the disk list.
+func newCloudStorage(disk string, diskIndex int) (StorageAPI, error) {
+	uri, err := parseCloudStorageURI(disk)
+	if err != nil {
+		return nil, err
+	}
+	if uri.scheme != cloudSchemeS3 {
+		return nil, fmt.Errorf("cloud storage disk %s: %s:// is not yet implemented, only s3:// is supported currently", disk, uri.scheme)
+	}
+
+	accessKey, secretKey, err := lookupCloudCreds(uri, diskIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := uri.query.Get("endpoint")
+	if endpoint == "" {
+		endpoint = "s3.amazonaws.com"
+	}
+	useSSL := uri.query.Get("insecure") != "true"
+
+	client, err := minio.New(endpoint, accessKey, secretKey, useSSL)
+	if err != nil {
+		return nil, fmt.Errorf("cloud storage disk %s: %s", disk, err)
+	}
+
+	return &cloudStorage{uri: uri, client: client, ctx: context.Background()}, nil
+}
+
+// contextualStorage is implemented by StorageAPI backends that can be
+// bound to a specific request context for tracing correlation, without
+// requiring every StorageAPI implementation in the full tree (most of
+// which aren't in this snapshot) to grow a context.Context parameter.
+type contextualStorage interface {
+	WithContext(ctx context.Context) StorageAPI
+}
+
+// WithContext returns a shallow copy of c bound to ctx, so storage spans
+// started through the copy are children of whatever span ctx carries
+// (typically the request span tracingMiddleware started via
+// startRequestSpan) rather than being rooted on their own. The object
+// layer would call this with the request's context before each StorageAPI
+// call; no such caller exists in this snapshot since newObjectLayer's body
+// isn't present here, so every disk in srvConfig.storageDisks still traces
+// with its default context.Background() root until that wiring lands.
+func (c *cloudStorage) WithContext(ctx context.Context) StorageAPI {
+	clone := *c
+	clone.ctx = ctx
+	return &clone
+}
+
+// objectKey joins the disk's prefix with a volume/path pair to form the
+// object key used against the backing bucket.
+func (c *cloudStorage) objectKey(volume, path string) string {
+	if path == "" {
+		return c.objectPrefix(volume)
+	}
+	return c.objectPrefix(volume) + "/" + path
+}
+
+// objectPrefix is objectKey without a trailing path, used to key volume
+// marker objects and ListObjects prefixes.
+func (c *cloudStorage) objectPrefix(volume string) string {
+	if c.uri.prefix == "" {
+		return volume
+	}
+	return c.uri.prefix + "/" + volume
+}
+
+func (c *cloudStorage) String() string {
+	return fmt.Sprintf("%s://%s/%s", c.uri.scheme, c.uri.bucket, c.uri.prefix)
+}
+
+// traceOp records a storage_disk_io_total sample and starts a tracing span
+// for a single StorageAPI call, returning a func to finish the span on
+// return. The span is rooted at c.ctx, which WithContext binds to a
+// request's context so these spans nest under the request span that
+// triggered them; a cloudStorage that never had WithContext called on it
+// still traces correctly, just without that correlation.
+func (c *cloudStorage) traceOp(method string) func() {
+	recordStorageOp(c.String(), method)
+	_, span := startStorageSpan(c.ctx, c.String(), method)
+	return span.Finish
+}
+
+func (c *cloudStorage) DiskInfo() (info disk.Info, err error) {
+	return disk.Info{}, errNotImplemented
+}
+
+// MakeVol writes a zero-byte marker object under the volume's prefix,
+// since S3 has no directory primitive for ListVols/StatVol to discover.
+func (c *cloudStorage) MakeVol(volume string) error {
+	defer c.traceOp("MakeVol")()
+	_, err := c.client.PutObject(c.uri.bucket, c.objectPrefix(volume)+"/", bytes.NewReader(nil), 0, minio.PutObjectOptions{})
+	return err
+}
+
+func (c *cloudStorage) ListVols() (vols []VolInfo, err error) {
+	defer c.traceOp("ListVols")()
+
+	prefix := c.uri.prefix
+	if prefix != "" {
+		prefix += "/"
+	}
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+	for obj := range c.client.ListObjects(c.uri.bucket, prefix, false, doneCh) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		if !strings.HasSuffix(obj.Key, "/") {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(obj.Key, prefix), "/")
+		if name == "" {
+			continue
+		}
+		vols = append(vols, VolInfo{Name: name, Created: obj.LastModified})
+	}
+	return vols, nil
+}
+
+func (c *cloudStorage) StatVol(volume string) (volInfo VolInfo, err error) {
+	defer c.traceOp("StatVol")()
+	vols, err := c.ListVols()
+	if err != nil {
+		return VolInfo{}, err
+	}
+	for _, v := range vols {
+		if v.Name == volume {
+			return v, nil
+		}
+	}
+	return VolInfo{}, errVolumeNotFound
+}
+
+func (c *cloudStorage) DeleteVol(volume string) error {
+	defer c.traceOp("DeleteVol")()
+	return c.client.RemoveObject(c.uri.bucket, c.objectPrefix(volume)+"/")
+}
+
+func (c *cloudStorage) ListDir(volume, dirPath string) ([]string, error) {
+	defer c.traceOp("ListDir")()
+
+	prefix := c.objectKey(volume, dirPath)
+	if prefix != "" {
+		prefix += "/"
+	}
+	var entries []string
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+	for obj := range c.client.ListObjects(c.uri.bucket, prefix, false, doneCh) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		entries = append(entries, strings.TrimPrefix(obj.Key, prefix))
+	}
+	return entries, nil
+}
+
+func (c *cloudStorage) ReadFile(volume string, path string, offset int64, buf []byte) (n int64, err error) {
+	defer c.traceOp("ReadFile")()
+
+	opts := minio.GetObjectOptions{}
+	if len(buf) > 0 {
+		if err = opts.SetRange(offset, offset+int64(len(buf))-1); err != nil {
+			return 0, err
+		}
+	}
+	obj, err := c.client.GetObject(c.uri.bucket, c.objectKey(volume, path), opts)
+	if err != nil {
+		return 0, err
+	}
+	defer obj.Close()
+
+	read, err := io.ReadFull(obj, buf)
+	return int64(read), err
+}
+
+// AppendFile reads the existing object back, appends buf, and writes the
+// whole object back. S3 has no append primitive; minio only ever appends
+// sequentially while streaming a single upload, so this is correct if
+// costly for very large objects.
+func (c *cloudStorage) AppendFile(volume string, path string, buf []byte) error {
+	defer c.traceOp("AppendFile")()
+
+	key := c.objectKey(volume, path)
+	obj, err := c.client.GetObject(c.uri.bucket, key, minio.GetObjectOptions{})
+	var existing []byte
+	if err == nil {
+		existing, err = ioutil.ReadAll(obj)
+		obj.Close()
+	}
+	if err != nil && minio.ToErrorResponse(err).Code != "NoSuchKey" {
+		return err
+	}
+
+	existing = append(existing, buf...)
+	_, err = c.client.PutObject(c.uri.bucket, key, bytes.NewReader(existing), int64(len(existing)), minio.PutObjectOptions{})
+	return err
+}
+
+func (c *cloudStorage) StatFile(volume string, path string) (file FileInfo, err error) {
+	defer c.traceOp("StatFile")()
+
+	info, err := c.client.StatObject(c.uri.bucket, c.objectKey(volume, path), minio.StatObjectOptions{})
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return FileInfo{
+		Volume:  volume,
+		Name:    path,
+		ModTime: info.LastModified,
+		Size:    info.Size,
+	}, nil
+}
+
+func (c *cloudStorage) DeleteFile(volume string, path string) error {
+	defer c.traceOp("DeleteFile")()
+	return c.client.RemoveObject(c.uri.bucket, c.objectKey(volume, path))
+}
+
+// RenameFile copies srcPath to dstPath and removes the source, since S3
+// has no atomic rename primitive.
+func (c *cloudStorage) RenameFile(srcVolume, srcPath, dstVolume, dstPath string) error {
+	defer c.traceOp("RenameFile")()
+
+	src := minio.NewSourceInfo(c.uri.bucket, c.objectKey(srcVolume, srcPath), nil)
+	dst, err := minio.NewDestinationInfo(c.uri.bucket, c.objectKey(dstVolume, dstPath), nil, nil)
+	if err != nil {
+		return err
+	}
+	if err = c.client.CopyObject(dst, src); err != nil {
+		return err
+	}
+	return c.client.RemoveObject(c.uri.bucket, c.objectKey(srcVolume, srcPath))
+}
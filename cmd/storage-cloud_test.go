@@ -0,0 +1,121 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+func TestIsCloudStorageDisk(t *testing.T) {
+	testCases := []struct {
+		disk    string
+		isCloud bool
+	}{
+		{"/mnt/export1", false},
+		{"192.168.1.1:/mnt/export1", false},
+		{"s3://cold-bucket/tier", true},
+		{"gs://cold-bucket/tier", true},
+		{"azure://cold-bucket/tier", true},
+		{"S3://cold-bucket/tier", true},
+		{"ftp://cold-bucket/tier", false},
+	}
+	for _, testCase := range testCases {
+		if got := isCloudStorageDisk(testCase.disk); got != testCase.isCloud {
+			t.Errorf("isCloudStorageDisk(%q) = %v, want %v", testCase.disk, got, testCase.isCloud)
+		}
+	}
+}
+
+func TestParseCloudStorageURI(t *testing.T) {
+	uri, err := parseCloudStorageURI("s3://cold-bucket/tier/prefix?region=us-east-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if uri.scheme != cloudSchemeS3 {
+		t.Errorf("expected scheme %q, got %q", cloudSchemeS3, uri.scheme)
+	}
+	if uri.bucket != "cold-bucket" {
+		t.Errorf("expected bucket %q, got %q", "cold-bucket", uri.bucket)
+	}
+	if uri.prefix != "tier/prefix" {
+		t.Errorf("expected prefix %q, got %q", "tier/prefix", uri.prefix)
+	}
+	if uri.query.Get("region") != "us-east-1" {
+		t.Errorf("expected region query param us-east-1, got %q", uri.query.Get("region"))
+	}
+}
+
+func TestParseCloudStorageURIMissingBucket(t *testing.T) {
+	if _, err := parseCloudStorageURI("s3:///tier"); err == nil {
+		t.Fatal("expected an error for a cloud storage URI with no bucket")
+	}
+}
+
+func TestNewCloudStorageRejectsUnsupportedScheme(t *testing.T) {
+	if _, err := newCloudStorage("gs://cold-bucket/tier", 0); err == nil {
+		t.Fatal("expected an error, gs:// is not yet implemented")
+	}
+}
+
+// TestCheckSufficientDisksCloudExemption verifies that an odd disk count
+// is only accepted when --replication-only is set and the list also mixes
+// in a cloud storage disk; neither condition alone is enough.
+func TestCheckSufficientDisksCloudExemption(t *testing.T) {
+	oddOnPremDisks := []string{"/mnt/export1", "/mnt/export2", "/mnt/export3", "/mnt/export4", "/mnt/export5"}
+	if err := checkSufficientDisks(oddOnPremDisks, true); err != errXLNumDisks {
+		t.Errorf("expected errXLNumDisks for an odd on-prem disk count even with replicationOnly set, got %v", err)
+	}
+
+	oddWithCloudDisk := []string{"/mnt/export1", "/mnt/export2", "/mnt/export3", "/mnt/export4", "s3://cold-bucket/tier"}
+	if err := checkSufficientDisks(oddWithCloudDisk, false); err != errXLNumDisks {
+		t.Errorf("expected errXLNumDisks for an odd disk count with a cloud disk but replicationOnly unset, got %v", err)
+	}
+	if err := checkSufficientDisks(oddWithCloudDisk, true); err != nil {
+		t.Errorf("expected odd disk count to be exempt with replicationOnly set and a cloud disk present, got %v", err)
+	}
+}
+
+// TestCloudStorageWithContextChainsSpans verifies a cloudStorage bound via
+// WithContext carries whatever span the given context holds, so a
+// request's span and its disk I/O spans stay correlated once the object
+// layer calls WithContext per request.
+func TestCloudStorageWithContextChainsSpans(t *testing.T) {
+	c := &cloudStorage{
+		uri: cloudStorageURI{scheme: cloudSchemeS3, bucket: "bucket", prefix: "tier"},
+		ctx: context.Background(),
+	}
+
+	var _ contextualStorage = c
+
+	reqCtx, reqSpan := startRequestSpan(context.Background(), "PutObject")
+	defer reqSpan.Finish()
+
+	scoped, ok := c.WithContext(reqCtx).(*cloudStorage)
+	if !ok {
+		t.Fatal("expected WithContext to return a *cloudStorage")
+	}
+
+	if opentracing.SpanFromContext(scoped.ctx) == nil {
+		t.Error("expected the bound cloudStorage's context to carry the request span")
+	}
+	if opentracing.SpanFromContext(c.ctx) != nil {
+		t.Error("expected WithContext to leave the original cloudStorage's context untouched")
+	}
+}
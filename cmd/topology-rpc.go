@@ -0,0 +1,59 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"net/rpc"
+
+	"github.com/gorilla/mux"
+)
+
+// topologyRPCPath is the RPC registration path for the topology
+// verification service, queried by peers at startup to confirm every
+// node was handed an identical --config-topology file.
+const topologyRPCPath = "/topology"
+
+// TopologyHashReply carries the hash of the topology file this node was
+// started with, in response to a Topology.Hash RPC call.
+type TopologyHashReply struct {
+	Hash string
+}
+
+// topologyRPCReceiver exposes the topology verification RPC handlers,
+// registered alongside the other RPC services in configureServerHandler.
+type topologyRPCReceiver struct {
+	topology serverTopology
+}
+
+// Hash returns the hash of the topology file this node started with, so
+// the caller can compare it against its own and detect a misconfigured
+// cluster before it causes confusing erasure-set mismatches.
+func (t *topologyRPCReceiver) Hash(args *struct{}, reply *TopologyHashReply) error {
+	reply.Hash = topologyHash(t.topology)
+	return nil
+}
+
+// registerTopologyRPCRouter mounts the topology verification RPC service
+// on router, so peers can query Topology.Hash via fetchPeerTopologyHash.
+func registerTopologyRPCRouter(router *mux.Router, topo serverTopology) error {
+	rpcServer := rpc.NewServer()
+	if err := rpcServer.RegisterName("Topology", &topologyRPCReceiver{topology: topo}); err != nil {
+		return err
+	}
+	router.Path(topologyRPCPath).Handler(rpcServer)
+	return nil
+}
@@ -0,0 +1,256 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Retry/backoff for dialing a peer's topology verification RPC at startup.
+// Nodes in a cluster are typically launched at roughly the same time, so a
+// peer's listener very likely isn't serving yet on the first attempt; this
+// mirrors the same bring-up race waitForFormatDisks already retries
+// through for disk quorum.
+const (
+	topologyVerifyRetries  = 10
+	topologyVerifyInterval = 2 * time.Second
+)
+
+// topologyDisk describes a single disk belonging to an erasure set, with
+// an optional ignore flag equivalent to --ignore-disks for that one disk.
+type topologyDisk struct {
+	Path   string `yaml:"path"`
+	Ignore bool   `yaml:"ignore,omitempty"`
+}
+
+// topologyErasureSet describes one data/parity grouping of disks, letting
+// a 12+ disk cluster be split into multiple erasure sets explicitly
+// instead of a single flat, positionally-ordered disk list.
+type topologyErasureSet struct {
+	Data   int            `yaml:"data"`
+	Parity int            `yaml:"parity"`
+	Disks  []topologyDisk `yaml:"disks"`
+}
+
+// topologyNode describes a single node's endpoint and the erasure sets it
+// is responsible for.
+type topologyNode struct {
+	Endpoint    string               `yaml:"endpoint"`
+	ErasureSets []topologyErasureSet `yaml:"erasure_sets"`
+}
+
+// serverTopology is the parsed form of a --config-topology file.
+type serverTopology struct {
+	Nodes []topologyNode `yaml:"nodes"`
+}
+
+// parseTopologyFile reads and unmarshals a --config-topology YAML file.
+func parseTopologyFile(path string) (serverTopology, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return serverTopology{}, err
+	}
+	var topo serverTopology
+	if err = yaml.Unmarshal(data, &topo); err != nil {
+		return serverTopology{}, fmt.Errorf("unable to parse topology file %s: %s", path, err)
+	}
+	if len(topo.Nodes) == 0 {
+		return serverTopology{}, fmt.Errorf("topology file %s describes no nodes", path)
+	}
+	return topo, nil
+}
+
+// topologyHash computes a stable hash over the entire cluster topology so
+// every node can verify, at startup, that it was handed an identical view
+// of the cluster.
+func topologyHash(topo serverTopology) string {
+	h := sha256.New()
+	for _, node := range topo.Nodes {
+		fmt.Fprintf(h, "node:%s\n", node.Endpoint)
+		for _, set := range node.ErasureSets {
+			fmt.Fprintf(h, "set:%d:%d\n", set.Data, set.Parity)
+			for _, d := range set.Disks {
+				fmt.Fprintf(h, "disk:%s:%v\n", d.Path, d.Ignore)
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// localNodeTopology returns the topology entry matching this server's own
+// endpoint. isLocalStorage is defined for disk arguments like
+// "ip:/mnt/disk" elsewhere in this package, not for a bare host:port
+// endpoint, so it isn't a reliable way to tell whether a topology entry is
+// this node; --address must be set to exactly the endpoint string used
+// for this node in the topology file.
+func localNodeTopology(topo serverTopology, serverAddr string) (topologyNode, error) {
+	for _, node := range topo.Nodes {
+		if node.Endpoint == serverAddr {
+			return node, nil
+		}
+	}
+	return topologyNode{}, fmt.Errorf("no node in topology file matches this server's address %s; start this node with --address set to its topology endpoint", serverAddr)
+}
+
+// peerEndpoints returns every node endpoint in the topology other than
+// this node's own, used to cross-check the topology hash at startup.
+func peerEndpoints(topo serverTopology, self topologyNode) (peers []string) {
+	for _, node := range topo.Nodes {
+		if node.Endpoint != self.Endpoint {
+			peers = append(peers, node.Endpoint)
+		}
+	}
+	return peers
+}
+
+// verifyClusterTopology exchanges the topology hash with every peer node
+// over RPC and refuses to start this node if any peer disagrees, which
+// would otherwise surface later as confusing erasure-set mismatches.
+func verifyClusterTopology(topo serverTopology, serverAddr string, port int) error {
+	self, err := localNodeTopology(topo, serverAddr)
+	if err != nil {
+		return err
+	}
+	localHash := topologyHash(topo)
+	for _, peer := range peerEndpoints(topo, self) {
+		peerHash, err := fetchPeerTopologyHashRetry(peer, port, topologyVerifyRetries, topologyVerifyInterval)
+		if err != nil {
+			return fmt.Errorf("unable to verify topology with peer %s: %s", peer, err)
+		}
+		if peerHash != localHash {
+			return fmt.Errorf("topology hash mismatch with peer %s: local %s, peer %s", peer, localHash, peerHash)
+		}
+	}
+	return nil
+}
+
+// fetchPeerTopologyHashRetry calls fetchPeerTopologyHash, retrying up to
+// retries times with a fixed interval between attempts so that a cluster
+// brought up all at once doesn't fail verification just because a peer's
+// listener isn't serving yet.
+func fetchPeerTopologyHashRetry(endpoint string, port, retries int, interval time.Duration) (hash string, err error) {
+	for attempt := 0; attempt < retries; attempt++ {
+		hash, err = fetchPeerTopologyHash(endpoint, port)
+		if err == nil {
+			return hash, nil
+		}
+		if attempt < retries-1 {
+			time.Sleep(interval)
+		}
+	}
+	return "", err
+}
+
+// fetchPeerTopologyHash dials the topology verification RPC a peer serves
+// at topologyRPCPath (registered by registerTopologyRPCRouter) and returns
+// the hash it was started with.
+func fetchPeerTopologyHash(endpoint string, port int) (string, error) {
+	host := endpoint
+	if h, _, err := net.SplitHostPort(endpoint); err == nil {
+		host = h
+	}
+
+	client, err := rpc.DialHTTPPath("tcp", fmt.Sprintf("%s:%d", host, port), topologyRPCPath)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	reply := TopologyHashReply{}
+	if err := client.Call("Topology.Hash", &struct{}{}, &reply); err != nil {
+		return "", err
+	}
+	return reply.Hash, nil
+}
+
+// diskPaths extracts the plain disk path list from a topology erasure set.
+func diskPaths(disks []topologyDisk) (paths []string) {
+	for _, d := range disks {
+		paths = append(paths, d.Path)
+	}
+	return paths
+}
+
+// ignoredDiskPaths extracts the paths of disks flagged ignore: true in a
+// topology erasure set, equivalent to --ignore-disks for that set.
+func ignoredDiskPaths(disks []topologyDisk) (paths []string) {
+	for _, d := range disks {
+		if d.Ignore {
+			paths = append(paths, d.Path)
+		}
+	}
+	return paths
+}
+
+// buildServerCmdConfigFromTopology turns a parsed topology file into a
+// serverCmdConfig, populating storageDisks and the per-set erasureSets
+// grouping instead of inferring either from a positional disk list.
+// replicationOnly is forwarded to validateDisks, see checkSufficientDisks.
+func buildServerCmdConfigFromTopology(topo serverTopology, serverAddr string, replicationOnly bool) (serverCmdConfig, error) {
+	node, err := localNodeTopology(topo, serverAddr)
+	if err != nil {
+		return serverCmdConfig{}, err
+	}
+
+	var allDisks, allIgnoredDisks []string
+	var erasureSets [][]StorageAPI
+	var allStorageDisks []StorageAPI
+	for _, set := range node.ErasureSets {
+		paths := diskPaths(set.Disks)
+		ignored := ignoredDiskPaths(set.Disks)
+		allDisks = append(allDisks, paths...)
+		allIgnoredDisks = append(allIgnoredDisks, ignored...)
+
+		setDisks := validateDisks(paths, ignored, replicationOnly)
+		erasureSets = append(erasureSets, setDisks)
+		allStorageDisks = append(allStorageDisks, setDisks...)
+	}
+
+	return serverCmdConfig{
+		serverAddr:   serverAddr,
+		disks:        allDisks,
+		ignoredDisks: allIgnoredDisks,
+		storageDisks: allStorageDisks,
+		erasureSets:  erasureSets,
+		isDistXL:     len(topo.Nodes) > 1,
+		topology:     &topo,
+	}, nil
+}
+
+// initDsyncNodesFromTopology sets up the distributed lock peers explicitly
+// from the other nodes' endpoints in the topology file, rather than
+// inferring them from this node's own disks the way initDsyncNodes does
+// for a positional disk list.
+func initDsyncNodesFromTopology(topo serverTopology, serverAddr string, port int) error {
+	self, err := localNodeTopology(topo, serverAddr)
+	if err != nil {
+		return err
+	}
+	peers := peerEndpoints(topo, self)
+	if len(peers) == 0 {
+		return nil
+	}
+	return initDsyncNodes(peers, port)
+}
@@ -0,0 +1,104 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func sampleTopology() serverTopology {
+	return serverTopology{
+		Nodes: []topologyNode{
+			{
+				Endpoint: "10.0.0.1:9000",
+				ErasureSets: []topologyErasureSet{
+					{Data: 4, Parity: 2, Disks: []topologyDisk{
+						{Path: "/mnt/export1"},
+						{Path: "/mnt/export2"},
+					}},
+				},
+			},
+			{
+				Endpoint: "10.0.0.2:9000",
+				ErasureSets: []topologyErasureSet{
+					{Data: 4, Parity: 2, Disks: []topologyDisk{
+						{Path: "/mnt/export3"},
+						{Path: "/mnt/export4"},
+					}},
+				},
+			},
+		},
+	}
+}
+
+// TestTopologyHashDeterministic verifies topologyHash is stable across
+// repeated calls and changes if any disk in the topology changes, since
+// verifyClusterTopology relies on byte-identical hashes to detect drift.
+func TestTopologyHashDeterministic(t *testing.T) {
+	topo := sampleTopology()
+	h1 := topologyHash(topo)
+	h2 := topologyHash(sampleTopology())
+	if h1 != h2 {
+		t.Errorf("expected topologyHash to be deterministic, got %s and %s", h1, h2)
+	}
+
+	mutated := sampleTopology()
+	mutated.Nodes[0].ErasureSets[0].Disks[0].Ignore = true
+	if h3 := topologyHash(mutated); h3 == h1 {
+		t.Error("expected topologyHash to change when a disk's ignore flag changes")
+	}
+}
+
+// TestPeerEndpointsExcludesSelf verifies peerEndpoints never returns the
+// caller's own endpoint, so verifyClusterTopology never dials itself.
+func TestPeerEndpointsExcludesSelf(t *testing.T) {
+	topo := sampleTopology()
+	self, err := localNodeTopology(topo, "10.0.0.1:9000")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	peers := peerEndpoints(topo, self)
+	if len(peers) != 1 || peers[0] != "10.0.0.2:9000" {
+		t.Errorf("expected peers [10.0.0.2:9000], got %v", peers)
+	}
+}
+
+// TestLocalNodeTopologyNoMatch verifies an unmatched server address is
+// reported as an error rather than silently picking the first node.
+func TestLocalNodeTopologyNoMatch(t *testing.T) {
+	topo := sampleTopology()
+	if _, err := localNodeTopology(topo, "10.0.0.9:9000"); err == nil {
+		t.Fatal("expected an error for a server address absent from the topology")
+	}
+}
+
+// TestFetchPeerTopologyHashRetryExhausts verifies fetchPeerTopologyHashRetry
+// returns an error once its attempts run out rather than retrying forever,
+// and that it waits the retry interval between attempts, against a port
+// nothing is listening on.
+func TestFetchPeerTopologyHashRetryExhausts(t *testing.T) {
+	start := time.Now()
+	_, err := fetchPeerTopologyHashRetry("127.0.0.1", 1, 3, time.Millisecond)
+	if err == nil {
+		t.Fatal("expected an error dialing a port nothing listens on")
+	}
+	if elapsed := time.Since(start); elapsed < 2*time.Millisecond {
+		t.Errorf("expected at least 2 retry intervals to elapse, got %s", elapsed)
+	}
+}
@@ -0,0 +1,99 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"context"
+	"net/http"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	jaeger "github.com/uber/jaeger-client-go"
+	jaegercfg "github.com/uber/jaeger-client-go/config"
+)
+
+// globalTracer is the OpenTracing-style tracer requests are recorded
+// against. It reports to MINIO_TRACE_ENDPOINT when configured, and is a
+// no-op tracer otherwise so call sites never need a nil check.
+var globalTracer opentracing.Tracer = opentracing.NoopTracer{}
+
+// initTracer configures globalTracer to export to globalTraceEndpoint,
+// called from initServerConfig once MINIO_TRACE_ENDPOINT has been read.
+func initTracer(traceEndpoint string) error {
+	if traceEndpoint == "" {
+		return nil
+	}
+	tracer, err := newJaegerTracer(traceEndpoint)
+	if err != nil {
+		return err
+	}
+	globalTracer = tracer
+	return nil
+}
+
+// newJaegerTracer builds a Jaeger-backed OpenTracing tracer that reports
+// spans to the given agent endpoint, e.g. "localhost:6831".
+func newJaegerTracer(endpoint string) (opentracing.Tracer, error) {
+	cfg := jaegercfg.Configuration{
+		ServiceName: "minio",
+		Sampler: &jaegercfg.SamplerConfig{
+			Type:  jaeger.SamplerTypeConst,
+			Param: 1,
+		},
+		Reporter: &jaegercfg.ReporterConfig{
+			LocalAgentHostPort: endpoint,
+		},
+	}
+	tracer, _, err := cfg.NewTracer()
+	if err != nil {
+		return nil, err
+	}
+	return tracer, nil
+}
+
+// startRequestSpan starts a span for a single S3 API request, to be
+// threaded through newObjectLayer and every StorageAPI call it makes so a
+// single PUT/GET can be followed across erasure disks and lock RPCs.
+func startRequestSpan(ctx context.Context, operation string) (context.Context, opentracing.Span) {
+	span := globalTracer.StartSpan(operation)
+	return opentracing.ContextWithSpan(ctx, span), span
+}
+
+// startStorageSpan starts a child span for a single StorageAPI call, e.g.
+// ReadFile/AppendFile/RenameFile, tagged with the disk it ran against.
+func startStorageSpan(ctx context.Context, disk, method string) (context.Context, opentracing.Span) {
+	parent := opentracing.SpanFromContext(ctx)
+	var span opentracing.Span
+	if parent != nil {
+		span = globalTracer.StartSpan(method, opentracing.ChildOf(parent.Context()))
+	} else {
+		span = globalTracer.StartSpan(method)
+	}
+	span.SetTag("disk", disk)
+	return opentracing.ContextWithSpan(ctx, span), span
+}
+
+// tracingMiddleware starts a request span via startRequestSpan around every
+// request the router serves and replaces the request's context with one
+// carrying that span, so handlers and StorageAPI calls made while serving
+// it can attach child spans with startStorageSpan.
+func tracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := startRequestSpan(r.Context(), requestLabel(r))
+		defer span.Finish()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
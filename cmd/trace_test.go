@@ -0,0 +1,69 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	jaeger "github.com/uber/jaeger-client-go"
+)
+
+// TestTracingMiddlewareStartsSpan verifies tracingMiddleware attaches a span
+// to the request context that reaches the wrapped handler.
+func TestTracingMiddlewareStartsSpan(t *testing.T) {
+	var sawSpan bool
+	handler := tracingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sawSpan = opentracing.SpanFromContext(r.Context()) != nil
+	}))
+
+	req := httptest.NewRequest("GET", "/anything", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !sawSpan {
+		t.Error("expected tracingMiddleware to attach a span to the request context")
+	}
+}
+
+// TestStartStorageSpanIsChildOfRequestSpan verifies a storage span started
+// from a context carrying a request span is linked as its child, so a
+// single S3 request's spans stay correlated across disk I/O.
+func TestStartStorageSpanIsChildOfRequestSpan(t *testing.T) {
+	tracer, closer := jaeger.NewTracer("minio-test", jaeger.NewConstSampler(true), jaeger.NewNullReporter())
+	defer closer.Close()
+	oldTracer := globalTracer
+	globalTracer = tracer
+	defer func() { globalTracer = oldTracer }()
+
+	ctx, reqSpan := startRequestSpan(context.Background(), "PutObject")
+	defer reqSpan.Finish()
+
+	_, storageSpan := startStorageSpan(ctx, "disk1", "AppendFile")
+	defer storageSpan.Finish()
+
+	if storageSpan == nil {
+		t.Fatal("expected a non-nil storage span")
+	}
+	reqCtx := reqSpan.Context().(jaeger.SpanContext)
+	storageCtx := storageSpan.Context().(jaeger.SpanContext)
+	if storageCtx.ParentID() != reqCtx.SpanID() {
+		t.Errorf("expected storage span parent %v to be the request span %v", storageCtx.ParentID(), reqCtx.SpanID())
+	}
+}